@@ -2,21 +2,29 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"image"
 	"image/color"
+	"image/draw"
+	"image/gif"
 	"image/jpeg"
 	"image/png"
 	"io/fs"
+	"math"
 	"math/rand"
 	"os"
 	"path/filepath"
+	"runtime"
 	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/fogleman/gg"
+	xdraw "golang.org/x/image/draw"
 	"golang.org/x/image/font"
 	"golang.org/x/image/font/opentype"
 	"golang.org/x/image/font/sfnt"
@@ -67,37 +75,93 @@ func isImageFile(filename string) bool {
 	return ok
 }
 
-// 添加水印
-func addWatermark(imagePath, watermarkText, outputPath string,
-	position string, opacity, fontSize int,
-	randomColor bool, shadowOffset [2]int, shadowOpacity int) error {
+// WatermarkPosition 描述水印的锚点，以及在锚点基础上的像素级微调偏移
+//
+// Anchor为"tile"时进入平铺模式，文字以TileAngle旋转后按TileSpacingX/TileSpacingY
+// 的网格间距铺满整张图片，常用于文档防盗用的斜向重复水印。
+type WatermarkPosition struct {
+	Anchor       string   `json:"anchor,omitempty"` // top-left/top-right/bottom-left/bottom-right/center/tile，留空表示以(Dx,Dy)作为绝对坐标
+	Dx           int      `json:"dx,omitempty"`
+	Dy           int      `json:"dy,omitempty"`
+	TileAngle    *float64 `json:"tile_angle,omitempty"`     // 平铺模式下的旋转角度（度），为nil时默认-30
+	TileSpacingX int      `json:"tile_spacing_x,omitempty"` // 平铺模式下相邻实例的水平间距，默认150
+	TileSpacingY int      `json:"tile_spacing_y,omitempty"` // 平铺模式下相邻实例的垂直间距，默认100
+}
 
-	// 读取原始图片
-	data, err := os.ReadFile(imagePath)
-	if err != nil {
-		return fmt.Errorf("无法读取图片: %v", err)
+// WatermarkShadow 描述水印阴影的偏移与透明度，为nil时不绘制阴影
+type WatermarkShadow struct {
+	OffsetX int `json:"offset_x"`
+	OffsetY int `json:"offset_y"`
+	Opacity int `json:"opacity"`
+}
+
+// WatermarkPlate 描述文字背后的半透明圆角背板，为nil时不绘制背板
+//
+// 用于在雪地、天空等亮色背景上提升白色文字的可读性。
+type WatermarkPlate struct {
+	Padding     int        `json:"padding,omitempty"`
+	Radius      float64    `json:"radius,omitempty"`
+	Color       color.RGBA `json:"color,omitempty"`
+	BorderColor color.RGBA `json:"border_color,omitempty"`
+	BorderWidth float64    `json:"border_width,omitempty"` // 大于0时绘制边框
+}
+
+// Watermark 描述单个独立的水印图层，供Apply叠加到图像上
+//
+// 一个图层可以只绘制文字、只绘制ImagePath指向的Logo图片，或二者同时绘制。
+type Watermark struct {
+	Text         string            `json:"text"`
+	FontPath     string            `json:"font_path,omitempty"`
+	Size         int               `json:"size,omitempty"`
+	Color        color.RGBA        `json:"color,omitempty"`
+	Opacity      *int              `json:"opacity,omitempty"` // 文字透明度，0-255，为nil时默认255
+	Position     WatermarkPosition `json:"position,omitempty"`
+	Rotation     float64           `json:"rotation,omitempty"` // 旋转角度（度），以文字中心为轴
+	Shadow       *WatermarkShadow  `json:"shadow,omitempty"`
+	Plate        *WatermarkPlate   `json:"plate,omitempty"`
+	ImagePath    string            `json:"image_path,omitempty"`    // 设置后叠加一张PNG/JPEG Logo图片
+	ImageScale   float64           `json:"image_scale,omitempty"`   // Logo宽度占画布宽度的比例，默认0.2
+	ImageOpacity int               `json:"image_opacity,omitempty"` // Logo透明度，0-255，默认255
+}
+
+// 确定水印颜色（随机色或默认白色）
+func watermarkColor(randomColor bool) color.RGBA {
+	if randomColor {
+		return color.RGBA{
+			R: uint8(randomGenerator.Intn(256)),
+			G: uint8(randomGenerator.Intn(256)),
+			B: uint8(randomGenerator.Intn(256)),
+			A: 255,
+		}
 	}
+	return color.RGBA{R: 255, G: 255, B: 255, A: 255} // 默认白色
+}
 
-	// 处理WebP格式，转换为PNG以便处理
-	ext := filepath.Ext(imagePath)
-	if ext == ".webp" {
-		// WebP格式处理逻辑已移除
-		return fmt.Errorf("暂时不支持WebP格式")
+// 解析"r,g,b,a"格式的颜色字符串，用于-bg-color等CLI参数
+func parseRGBAColor(s string) (color.RGBA, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return color.RGBA{}, fmt.Errorf("颜色格式应为 r,g,b,a，实际为: %s", s)
 	}
 
-	// 解码图片
-	img, _, err := image.Decode(bytes.NewReader(data))
-	if err != nil {
-		return fmt.Errorf("解码图片失败: %v", err)
+	channels := make([]uint8, 4)
+	for i, part := range parts {
+		val, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || val < 0 || val > 255 {
+			return color.RGBA{}, fmt.Errorf("颜色分量必须是0-255之间的整数: %s", part)
+		}
+		channels[i] = uint8(val)
 	}
 
-	// 创建绘图上下文
-	dc := gg.NewContextForImage(img)
-	bounds := img.Bounds()
-	width, height := bounds.Max.X, bounds.Max.Y
+	return color.RGBA{R: channels[0], G: channels[1], B: channels[2], A: channels[3]}, nil
+}
+
+// 加载图层字体，优先使用图层指定的字体，失败时回退到gg库的默认字体加载机制
+func loadLayerFace(dc *gg.Context, fontPath string, fontSize int) {
+	if fontPath == "" {
+		fontPath = getSystemFont()
+	}
 
-	// 加载字体
-	fontPath := getSystemFont()
 	var face font.Face
 	if fontPath != "" {
 		fontData, err := os.ReadFile(fontPath)
@@ -112,26 +176,131 @@ func addWatermark(imagePath, watermarkText, outputPath string,
 		}
 	}
 
-	// 如果加载字体失败，使用备用方案
 	if face == nil {
 		fmt.Println("警告: 无法加载指定字体，使用备用字体")
-		// 尝试使用gg库的默认字体加载机制
 		if err := dc.LoadFontFace("sans-serif", float64(fontSize)); err != nil {
-			// 如果仍然失败，使用内置字体
 			fmt.Println("警告: 无法加载备用字体，使用内置字体")
 		}
 	} else {
 		dc.SetFontFace(face)
 	}
+}
+
+// logoCache缓存已解码的Logo图片，避免GIF等多帧场景下重复读盘解码同一张Logo
+var logoCache sync.Map
+
+// 按路径加载Logo图片，命中缓存时直接复用已解码的结果
+func loadLogoImage(path string) (image.Image, error) {
+	if cached, ok := logoCache.Load(path); ok {
+		return cached.(image.Image), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("无法读取Logo图片: %v", err)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("解码Logo图片失败: %v", err)
+	}
+
+	logoCache.Store(path, img)
+	return img, nil
+}
+
+// 在画布上叠加图层自带的Logo图片，支持与文字共用相同的命名锚点
+func drawImageLayer(dc *gg.Context, width, height int, w Watermark) error {
+	logoImg, err := loadLogoImage(w.ImagePath)
+	if err != nil {
+		return err
+	}
+
+	scale := w.ImageScale
+	if scale <= 0 {
+		scale = 0.2
+	}
+
+	logoBounds := logoImg.Bounds()
+	targetWidth := int(float64(width) * scale)
+	targetHeight := targetWidth * logoBounds.Dy() / logoBounds.Dx()
+
+	resizedLogo := image.NewRGBA(image.Rect(0, 0, targetWidth, targetHeight))
+	xdraw.BiLinear.Scale(resizedLogo, resizedLogo.Bounds(), logoImg, logoBounds, xdraw.Over, nil)
+
+	margin := 10
+	var x, y int
+	switch w.Position.Anchor {
+	case "top-left":
+		x, y = margin, margin
+	case "top-right":
+		x = width - targetWidth - margin
+		y = margin
+	case "bottom-left":
+		x = margin
+		y = height - targetHeight - margin
+	case "center":
+		x = (width - targetWidth) / 2
+		y = (height - targetHeight) / 2
+	case "bottom-right":
+		x = width - targetWidth - margin
+		y = height - targetHeight - margin
+	case "":
+		// 未指定锚点时，偏移量作为相对画布原点的绝对坐标
+	default:
+		x = width - targetWidth - margin
+		y = height - targetHeight - margin
+	}
+	x += w.Position.Dx
+	y += w.Position.Dy
+
+	mask := image.NewUniform(color.Alpha{A: uint8(w.ImageOpacity)})
+	dstRect := image.Rect(x, y, x+targetWidth, y+targetHeight)
+	draw.DrawMask(dc.Image().(*image.RGBA), dstRect, resizedLogo, image.Point{}, mask, image.Point{}, draw.Over)
+
+	return nil
+}
+
+// 在画布上绘制一个水印图层（字体、颜色、位置、旋转、阴影均取自该图层自身）
+func drawLayer(dc *gg.Context, width, height int, w Watermark) error {
+	if w.ImagePath != "" {
+		if err := drawImageLayer(dc, width, height, w); err != nil {
+			return err
+		}
+	}
+
+	if w.Text == "" {
+		return nil
+	}
+
+	fontSize := w.Size
+	if fontSize <= 0 {
+		fontSize = 30
+	}
+	loadLayerFace(dc, w.FontPath, fontSize)
+
+	// -layer JSON省略color/opacity时回退到默认的不透明白色，避免渲染出不可见的水印
+	if w.Color == (color.RGBA{}) {
+		w.Color = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	}
+	if w.Opacity == nil {
+		defaultOpacity := 255
+		w.Opacity = &defaultOpacity
+	}
+
+	if w.Position.Anchor == "tile" {
+		drawTiledLayer(dc, width, height, w)
+		return nil
+	}
 
 	// 计算文本尺寸
-	textWidth, textHeight := dc.MeasureString(watermarkText)
+	textWidth, textHeight := dc.MeasureString(w.Text)
 
 	// 计算水印位置
 	margin := 10
 	var x, y float64
 
-	switch position {
+	switch w.Position.Anchor {
 	case "top-left":
 		x, y = float64(margin), float64(margin)
 	case "top-right":
@@ -143,33 +312,294 @@ func addWatermark(imagePath, watermarkText, outputPath string,
 	case "center":
 		x = (float64(width) - textWidth) / 2
 		y = (float64(height) - textHeight) / 2
-	default: // bottom-right
+	case "bottom-right":
+		x = float64(width) - textWidth - float64(margin)
+		y = float64(height) - textHeight - float64(margin)
+	case "":
+		// 未指定锚点时，偏移量作为相对画布原点的绝对坐标；DrawString以y为文字基线，
+		// 这里预先加上textHeight，使Dx=Dy=0时文字基线落在画布内而非完全绘制到可见区域之外
+		y = textHeight
+	default:
 		x = float64(width) - textWidth - float64(margin)
 		y = float64(height) - textHeight - float64(margin)
 	}
 
-	// 确定水印颜色
-	var r, g, b uint8
-	if randomColor {
-		r = uint8(randomGenerator.Intn(256))
-		g = uint8(randomGenerator.Intn(256))
-		b = uint8(randomGenerator.Intn(256))
+	// 叠加像素级微调偏移
+	x += float64(w.Position.Dx)
+	y += float64(w.Position.Dy)
+
+	drawPlate := func() {
+		if w.Plate == nil {
+			return
+		}
+		// -layer JSON省略color/border_color时回退到默认的不透明白色，避免绘制出不可见的背板
+		if w.Plate.Color == (color.RGBA{}) {
+			w.Plate.Color = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+		}
+		if w.Plate.BorderColor == (color.RGBA{}) {
+			w.Plate.BorderColor = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+		}
+		pad := float64(w.Plate.Padding)
+		plateX := x - pad
+		plateY := y - pad
+		plateW := textWidth + 2*pad
+		plateH := textHeight + 2*pad
+
+		dc.DrawRoundedRectangle(plateX, plateY, plateW, plateH, w.Plate.Radius)
+		dc.SetColor(w.Plate.Color)
+		if w.Plate.BorderWidth > 0 {
+			dc.FillPreserve()
+			dc.SetColor(w.Plate.BorderColor)
+			dc.SetLineWidth(w.Plate.BorderWidth)
+			dc.Stroke()
+		} else {
+			dc.Fill()
+		}
+	}
+
+	drawText := func() {
+		if w.Shadow != nil {
+			// 设置阴影颜色（比文字颜色深一些）
+			shadowR := max(0, int(w.Color.R)-100)
+			shadowG := max(0, int(w.Color.G)-100)
+			shadowB := max(0, int(w.Color.B)-100)
+			dc.SetColor(color.RGBA{uint8(shadowR), uint8(shadowG), uint8(shadowB), uint8(w.Shadow.Opacity)})
+			dc.DrawString(w.Text, x+float64(w.Shadow.OffsetX), y+float64(w.Shadow.OffsetY))
+		}
+
+		// 绘制文字
+		dc.SetColor(color.RGBA{w.Color.R, w.Color.G, w.Color.B, uint8(*w.Opacity)})
+		dc.DrawString(w.Text, x, y)
+	}
+
+	if w.Rotation != 0 {
+		cx := x + textWidth/2
+		cy := y + textHeight/2
+		dc.Push()
+		dc.RotateAbout(gg.Radians(w.Rotation), cx, cy)
+		drawPlate()
+		drawText()
+		dc.Pop()
 	} else {
-		r, g, b = 255, 255, 255 // 默认白色
+		drawPlate()
+		drawText()
 	}
 
-	// 设置阴影颜色（比文字颜色深一些）
-	shadowR := max(0, int(r)-100)
-	shadowG := max(0, int(g)-100)
-	shadowB := max(0, int(b)-100)
+	return nil
+}
+
+// resizeToFit 按比例将图像缩放到指定的最大宽高以内，maxWidth/maxHeight为0表示该方向不限制
+//
+// 在水印叠加前统一画布尺寸，使字体大小和边距不再受输入图片分辨率影响。
+func resizeToFit(img image.Image, maxWidth, maxHeight int) image.Image {
+	if maxWidth <= 0 && maxHeight <= 0 {
+		return img
+	}
 
-	// 绘制阴影
-	dc.SetColor(color.RGBA{uint8(shadowR), uint8(shadowG), uint8(shadowB), uint8(shadowOpacity)})
-	dc.DrawString(watermarkText, x+float64(shadowOffset[0]), y+float64(shadowOffset[1]))
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
 
-	// 绘制文字
-	dc.SetColor(color.RGBA{r, g, b, uint8(opacity)})
-	dc.DrawString(watermarkText, x, y)
+	width, height := srcW, srcH
+	switch {
+	case maxWidth > 0 && maxHeight > 0:
+		widthScale := float64(maxWidth) / float64(srcW)
+		heightScale := float64(maxHeight) / float64(srcH)
+		scale := widthScale
+		if heightScale < scale {
+			scale = heightScale
+		}
+		width = int(float64(srcW) * scale)
+		height = int(float64(srcH) * scale)
+	case maxWidth > 0:
+		width = maxWidth
+		height = maxWidth * srcH / srcW
+	case maxHeight > 0:
+		height = maxHeight
+		width = maxHeight * srcW / srcH
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	xdraw.BiLinear.Scale(dst, dst.Bounds(), img, bounds, xdraw.Over, nil)
+	return dst
+}
+
+// drawTiledLayer 以旋转网格的方式将文字铺满整张画布，生成常见的"confidential"斜向重复水印
+func drawTiledLayer(dc *gg.Context, width, height int, w Watermark) {
+	angle := -30.0
+	if w.Position.TileAngle != nil {
+		angle = *w.Position.TileAngle
+	}
+	spacingX := w.Position.TileSpacingX
+	if spacingX <= 0 {
+		spacingX = 150
+	}
+	spacingY := w.Position.TileSpacingY
+	if spacingY <= 0 {
+		spacingY = 100
+	}
+
+	textWidth, textHeight := dc.MeasureString(w.Text)
+	rad := gg.Radians(angle)
+
+	// 单个文本实例旋转后的外接矩形尺寸，决定网格单元的大小
+	rotatedW := math.Abs(textWidth*math.Cos(rad)) + math.Abs(textHeight*math.Sin(rad))
+	rotatedH := math.Abs(textWidth*math.Sin(rad)) + math.Abs(textHeight*math.Cos(rad))
+	cellW := rotatedW + float64(spacingX)
+	cellH := rotatedH + float64(spacingY)
+
+	// 多铺出一圈，避免画布四角缺角
+	cols := int(float64(width)/cellW) + 2
+	rows := int(float64(height)/cellH) + 2
+
+	for row := -1; row <= rows; row++ {
+		for col := -1; col <= cols; col++ {
+			cx := float64(col) * cellW
+			cy := float64(row) * cellH
+			x := cx - textWidth/2
+			y := cy - textHeight/2
+
+			dc.Push()
+			dc.RotateAbout(rad, cx, cy)
+
+			if w.Shadow != nil {
+				shadowR := max(0, int(w.Color.R)-100)
+				shadowG := max(0, int(w.Color.G)-100)
+				shadowB := max(0, int(w.Color.B)-100)
+				dc.SetColor(color.RGBA{uint8(shadowR), uint8(shadowG), uint8(shadowB), uint8(w.Shadow.Opacity)})
+				dc.DrawString(w.Text, x+float64(w.Shadow.OffsetX), y+float64(w.Shadow.OffsetY))
+			}
+
+			dc.SetColor(color.RGBA{w.Color.R, w.Color.G, w.Color.B, uint8(*w.Opacity)})
+			dc.DrawString(w.Text, x, y)
+
+			dc.Pop()
+		}
+	}
+}
+
+// Apply 在图像上依次叠加多个独立的水印图层，返回新的图像
+//
+// 供库调用方以编程方式使用，无需经过CLI参数。
+func Apply(img image.Image, layers []Watermark) (image.Image, error) {
+	dc := gg.NewContextForImage(img)
+	bounds := img.Bounds()
+	width, height := bounds.Max.X, bounds.Max.Y
+
+	for _, layer := range layers {
+		if err := drawLayer(dc, width, height, layer); err != nil {
+			return nil, err
+		}
+	}
+
+	return dc.Image(), nil
+}
+
+// 为动图的每一帧叠加水印，保留原始调色板、延迟、循环次数和处理方式
+func addGIFWatermark(data []byte, outputPath string, layers []Watermark, maxWidth, maxHeight int) error {
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("解码GIF失败: %v", err)
+	}
+
+	canvasBounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+
+	// 许多GIF为减小体积，每一帧只编码发生变化的局部矩形，播放时依赖disposal方式
+	// 叠加在上一帧画面之上。按播放规则在完整画布上逐帧累积后再整体加水印，
+	// 确保只更新局部矩形（不覆盖水印位置）的帧也能显示水印。
+	canvas := image.NewRGBA(canvasBounds)
+
+	// 目标画布大小在遍历前确定一次，保证每一帧缩放到同样的尺寸
+	resizedBounds := resizeToFit(canvas, maxWidth, maxHeight).Bounds()
+	g.Config.Width = resizedBounds.Dx()
+	g.Config.Height = resizedBounds.Dy()
+
+	for i, frame := range g.Image {
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+
+		// 复制一份当前完整画面用于绘制水印，避免污染下一帧使用的累积画布
+		snapshot := image.NewRGBA(canvasBounds)
+		draw.Draw(snapshot, canvasBounds, canvas, canvasBounds.Min, draw.Src)
+
+		// 按需将每一帧缩放到目标宽高，保证水印字体大小和边距的渲染效果与其他格式一致
+		resized := resizeToFit(snapshot, maxWidth, maxHeight)
+
+		out, err := Apply(resized, layers)
+		if err != nil {
+			return fmt.Errorf("绘制水印失败: %v", err)
+		}
+
+		// 通过最近色匹配量化回原始调色板，输出完整画布大小的帧，避免只更新局部
+		// 矩形的写回方式裁掉水印
+		quantized := image.NewPaletted(resizedBounds, frame.Palette)
+		draw.Draw(quantized, resizedBounds, out, resizedBounds.Min, draw.Src)
+		g.Image[i] = quantized
+
+		disposal := byte(gif.DisposalNone)
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+			g.Disposal[i] = gif.DisposalNone
+		}
+		if disposal == gif.DisposalBackground {
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return fmt.Errorf("无法创建输出目录: %v", err)
+	}
+
+	outputFile, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("无法创建输出文件: %v", err)
+	}
+	defer outputFile.Close()
+
+	if err := gif.EncodeAll(outputFile, g); err != nil {
+		return fmt.Errorf("保存GIF失败: %v", err)
+	}
+
+	fmt.Printf("已处理: %s\n", outputPath)
+	return nil
+}
+
+// 添加水印
+func addWatermark(imagePath, outputPath string, layers []Watermark, maxWidth, maxHeight, quality int) error {
+	// 读取原始图片
+	data, err := os.ReadFile(imagePath)
+	if err != nil {
+		return fmt.Errorf("无法读取图片: %v", err)
+	}
+
+	// 处理WebP格式，转换为PNG以便处理
+	ext := filepath.Ext(imagePath)
+	if ext == ".webp" {
+		// WebP格式处理逻辑已移除
+		return fmt.Errorf("暂时不支持WebP格式")
+	}
+
+	// 动图单独走逐帧处理，保留动画效果
+	if ext == ".gif" {
+		if outputPath == "" {
+			dirName, fileName := filepath.Split(imagePath)
+			name := fileName[:len(fileName)-len(filepath.Ext(fileName))]
+			outputPath = filepath.Join(dirName, name+"_watermark"+ext)
+		}
+		return addGIFWatermark(data, outputPath, layers, maxWidth, maxHeight)
+	}
+
+	// 解码图片
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("解码图片失败: %v", err)
+	}
+
+	// 按需将输入缩放到目标宽高，保证水印字体大小和边距的渲染效果一致
+	img = resizeToFit(img, maxWidth, maxHeight)
+
+	out, err := Apply(img, layers)
+	if err != nil {
+		return fmt.Errorf("绘制水印失败: %v", err)
+	}
 
 	// 确定输出路径和格式
 	if outputPath == "" {
@@ -200,11 +630,11 @@ func addWatermark(imagePath, watermarkText, outputPath string,
 	// 根据扩展名选择保存格式
 	outputExt := filepath.Ext(outputPath)
 	if outputExt == ".png" {
-		if err := png.Encode(outputFile, dc.Image()); err != nil {
+		if err := png.Encode(outputFile, out); err != nil {
 			return fmt.Errorf("保存PNG失败: %v", err)
 		}
 	} else { // 默认保存为JPG
-		if err := jpeg.Encode(outputFile, dc.Image(), &jpeg.Options{Quality: 90}); err != nil {
+		if err := jpeg.Encode(outputFile, out, &jpeg.Options{Quality: quality}); err != nil {
 			return fmt.Errorf("保存JPG失败: %v", err)
 		}
 	}
@@ -213,11 +643,15 @@ func addWatermark(imagePath, watermarkText, outputPath string,
 	return nil
 }
 
-// 批量处理目录
-func processDirectory(inputDir, watermarkText, outputDir string,
-	position string, opacity, fontSize int,
-	randomColor bool, shadowOffset [2]int, shadowOpacity int) error {
+// watermarkJob 描述一个待处理文件及其提前分配好的输出路径
+type watermarkJob struct {
+	index      int
+	inputPath  string
+	outputPath string
+}
 
+// 批量处理目录，使用工作池并发处理并汇报进度
+func processDirectory(inputDir, outputDir string, layers []Watermark, maxWidth, maxHeight, quality, workers int) error {
 	// 获取所有图片文件
 	var imageFiles []string
 	err := filepath.WalkDir(inputDir, func(path string, d fs.DirEntry, err error) error {
@@ -251,12 +685,17 @@ func processDirectory(inputDir, watermarkText, outputDir string,
 		fmt.Printf("将输出文件保存到: %s\n", outputDir)
 	}
 
-	// 处理每个图片
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	// 提前分配好每个文件的序号和输出路径，保证文件名与文件顺序无关于调度方式
+	total := len(imageFiles)
+	jobs := make(chan watermarkJob, total)
 	for i, filePath := range imageFiles {
 		filename := filepath.Base(filePath)
 		ext := filepath.Ext(filename)
 
-		// 生成序号文件名
 		var outputFilename string
 		if ext == ".webp" {
 			outputFilename = strconv.Itoa(i+1) + ".jpg"
@@ -264,14 +703,37 @@ func processDirectory(inputDir, watermarkText, outputDir string,
 			outputFilename = strconv.Itoa(i+1) + ext
 		}
 
-		outputPath := filepath.Join(outputDir, outputFilename)
-
-		// 添加水印
-		if err := addWatermark(filePath, watermarkText, outputPath,
-			position, opacity, fontSize, randomColor, shadowOffset, shadowOpacity); err != nil {
-			fmt.Printf("处理 %s 时出错: %v\n", filePath, err)
+		jobs <- watermarkJob{
+			index:      i + 1,
+			inputPath:  filePath,
+			outputPath: filepath.Join(outputDir, outputFilename),
 		}
 	}
+	close(jobs)
+
+	var wg sync.WaitGroup
+	var errMu sync.Mutex
+	var errs []string
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				fmt.Printf("[%d/%d] %s\n", job.index, total, filepath.Base(job.inputPath))
+				if err := addWatermark(job.inputPath, job.outputPath, layers, maxWidth, maxHeight, quality); err != nil {
+					errMu.Lock()
+					errs = append(errs, fmt.Sprintf("处理 %s 时出错: %v", job.inputPath, err))
+					errMu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, errMsg := range errs {
+		fmt.Println(errMsg)
+	}
 
 	return nil
 }
@@ -299,6 +761,21 @@ func main() {
 	shadowOffsetX := 2
 	shadowOffsetY := 2
 	shadowOpacity := 100
+	drawBg := false
+	bgPad := 10
+	bgRadius := 8.0
+	bgColor := "0,0,0,160"
+	maxWidth := 0
+	maxHeight := 0
+	quality := 90
+	workers := 0
+	tileAngle := -30.0
+	tileSpacingX := 150
+	tileSpacingY := 100
+	imgPath := ""
+	imgScale := 0.2
+	imgOpacity := 255
+	var layerArgs []string
 
 	// 手动解析命令行参数
 	inputPath := ""
@@ -344,6 +821,84 @@ func main() {
 				shadowOpacity = val
 			}
 			i++
+		} else if os.Args[i] == "-bg" {
+			drawBg = true
+		} else if os.Args[i] == "-bg-pad" && i+1 < len(os.Args) {
+			// 转换为整数
+			if val, err := strconv.Atoi(os.Args[i+1]); err == nil {
+				bgPad = val
+			}
+			i++
+		} else if os.Args[i] == "-bg-radius" && i+1 < len(os.Args) {
+			// 转换为浮点数
+			if val, err := strconv.ParseFloat(os.Args[i+1], 64); err == nil {
+				bgRadius = val
+			}
+			i++
+		} else if os.Args[i] == "-bg-color" && i+1 < len(os.Args) {
+			bgColor = os.Args[i+1]
+			i++
+		} else if (os.Args[i] == "-w" || os.Args[i] == "-max-width") && i+1 < len(os.Args) {
+			// 转换为整数
+			if val, err := strconv.Atoi(os.Args[i+1]); err == nil {
+				maxWidth = val
+			}
+			i++
+		} else if os.Args[i] == "-max-height" && i+1 < len(os.Args) {
+			// 转换为整数
+			if val, err := strconv.Atoi(os.Args[i+1]); err == nil {
+				maxHeight = val
+			}
+			i++
+		} else if os.Args[i] == "-quality" && i+1 < len(os.Args) {
+			// 转换为整数
+			if val, err := strconv.Atoi(os.Args[i+1]); err == nil {
+				quality = val
+			}
+			i++
+		} else if os.Args[i] == "-j" && i+1 < len(os.Args) {
+			// 转换为整数，决定批量处理时并发的工作协程数量
+			if val, err := strconv.Atoi(os.Args[i+1]); err == nil {
+				workers = val
+			}
+			i++
+		} else if os.Args[i] == "-tile-angle" && i+1 < len(os.Args) {
+			// 转换为浮点数
+			if val, err := strconv.ParseFloat(os.Args[i+1], 64); err == nil {
+				tileAngle = val
+			}
+			i++
+		} else if os.Args[i] == "-tile-spacing-x" && i+1 < len(os.Args) {
+			// 转换为整数
+			if val, err := strconv.Atoi(os.Args[i+1]); err == nil {
+				tileSpacingX = val
+			}
+			i++
+		} else if os.Args[i] == "-tile-spacing-y" && i+1 < len(os.Args) {
+			// 转换为整数
+			if val, err := strconv.Atoi(os.Args[i+1]); err == nil {
+				tileSpacingY = val
+			}
+			i++
+		} else if os.Args[i] == "-img" && i+1 < len(os.Args) {
+			imgPath = os.Args[i+1]
+			i++
+		} else if os.Args[i] == "-img-scale" && i+1 < len(os.Args) {
+			// 转换为浮点数
+			if val, err := strconv.ParseFloat(os.Args[i+1], 64); err == nil {
+				imgScale = val
+			}
+			i++
+		} else if os.Args[i] == "-img-opacity" && i+1 < len(os.Args) {
+			// 转换为整数
+			if val, err := strconv.Atoi(os.Args[i+1]); err == nil {
+				imgOpacity = val
+			}
+			i++
+		} else if os.Args[i] == "-layer" && i+1 < len(os.Args) {
+			// 每个-layer都是一段描述单个图层的JSON，可重复传入实现多图层
+			layerArgs = append(layerArgs, os.Args[i+1])
+			i++
 		} else if inputPath == "" {
 			inputPath = os.Args[i]
 		}
@@ -358,6 +913,12 @@ func main() {
 		// 显示使用帮助
 		fmt.Println("使用方法:")
 		fmt.Println("  watermark [输入路径] -t [水印文字] -o [输出路径] -p [水印位置] -a [透明度] -s [字体大小] -n [不使用随机颜色] -sox [阴影X偏移] -soy [阴影Y偏移] -sa [阴影透明度]")
+		fmt.Println("  -bg 在文字背后绘制半透明背板，配合 -bg-pad [内边距] -bg-radius [圆角半径] -bg-color [r,g,b,a] 使用")
+		fmt.Println("  -w/-max-width [目标宽度] -max-height [目标高度] 在加水印前按比例缩放图片，-quality [1-100] 设置JPEG编码质量")
+		fmt.Println("  -j [并发数] 批量处理目录时使用的工作协程数量，默认等于CPU核心数")
+		fmt.Println("  -p tile 以旋转网格平铺整张图片，配合 -tile-angle [角度，默认-30] -tile-spacing-x -tile-spacing-y 使用")
+		fmt.Println("  -img [Logo图片路径] 叠加图片水印，可与文字水印同时使用，配合 -img-scale [占画布宽度比例] -img-opacity [0-255] 使用")
+		fmt.Println("  watermark [输入路径] -layer '{\"text\":\"标题\",\"position\":{\"anchor\":\"top-left\"}}' -layer '...' 可叠加多个独立图层")
 		fmt.Println("  水印位置: top-left, top-right, bottom-left, bottom-right, center")
 		fmt.Println("  透明度范围: 0-255")
 		return
@@ -380,22 +941,100 @@ func main() {
 		return
 	}
 
+	if imgOpacity < 0 || imgOpacity > 255 {
+		fmt.Println("Logo透明度必须在0-255之间")
+		return
+	}
+
 	if size <= 0 {
 		fmt.Println("字体大小必须大于0")
 		return
 	}
 
-	// 检查位置参数有效性
-	validPositions := map[string]bool{
+	if quality < 1 || quality > 100 {
+		fmt.Println("JPEG质量必须在1-100之间")
+		return
+	}
+
+	// 组装水印图层：优先使用-layer传入的多图层，否则回退为单图层的传统命令行参数
+	// 检查位置参数有效性，""表示以(Dx,Dy)作为绝对坐标
+	validAnchors := map[string]bool{
+		"":             true,
 		"top-left":     true,
 		"top-right":    true,
 		"bottom-left":  true,
 		"bottom-right": true,
 		"center":       true,
+		"tile":         true,
 	}
-	if !validPositions[position] {
-		fmt.Println("无效的位置参数")
-		return
+
+	var layers []Watermark
+	if len(layerArgs) > 0 {
+		for _, raw := range layerArgs {
+			var layer Watermark
+			if err := json.Unmarshal([]byte(raw), &layer); err != nil {
+				fmt.Printf("无效的-layer参数: %v\n", err)
+				return
+			}
+			if !validAnchors[layer.Position.Anchor] {
+				fmt.Printf("无效的位置参数: %s\n", layer.Position.Anchor)
+				return
+			}
+			layers = append(layers, layer)
+		}
+	} else {
+		// 检查位置参数有效性
+		validPositions := map[string]bool{
+			"top-left":     true,
+			"top-right":    true,
+			"bottom-left":  true,
+			"bottom-right": true,
+			"center":       true,
+			"tile":         true,
+		}
+		if !validPositions[position] {
+			fmt.Println("无效的位置参数")
+			return
+		}
+
+		var plate *WatermarkPlate
+		if drawBg {
+			plateColor, err := parseRGBAColor(bgColor)
+			if err != nil {
+				fmt.Printf("无效的-bg-color参数: %v\n", err)
+				return
+			}
+			plate = &WatermarkPlate{
+				Padding: bgPad,
+				Radius:  bgRadius,
+				Color:   plateColor,
+			}
+		}
+
+		randomColor := !noRandomColor
+		layers = []Watermark{
+			{
+				Text:    text,
+				Size:    size,
+				Color:   watermarkColor(randomColor),
+				Opacity: &opacity,
+				Position: WatermarkPosition{
+					Anchor:       position,
+					TileAngle:    &tileAngle,
+					TileSpacingX: tileSpacingX,
+					TileSpacingY: tileSpacingY,
+				},
+				Shadow: &WatermarkShadow{
+					OffsetX: shadowOffsetX,
+					OffsetY: shadowOffsetY,
+					Opacity: shadowOpacity,
+				},
+				Plate:        plate,
+				ImagePath:    imgPath,
+				ImageScale:   imgScale,
+				ImageOpacity: imgOpacity,
+			},
+		}
 	}
 
 	// 判断输入路径类型
@@ -405,13 +1044,9 @@ func main() {
 		return
 	}
 
-	shadowOffset := [2]int{shadowOffsetX, shadowOffsetY}
-	randomColor := !noRandomColor
-
 	if fileInfo.IsDir() {
 		// 处理目录
-		if err := processDirectory(inputPath, text, output,
-			position, opacity, size, randomColor, shadowOffset, shadowOpacity); err != nil {
+		if err := processDirectory(inputPath, output, layers, maxWidth, maxHeight, quality, workers); err != nil {
 			fmt.Printf("处理目录时出错: %v\n", err)
 		}
 	} else {
@@ -421,8 +1056,7 @@ func main() {
 			return
 		}
 
-		if err := addWatermark(inputPath, text, output,
-			position, opacity, size, randomColor, shadowOffset, shadowOpacity); err != nil {
+		if err := addWatermark(inputPath, output, layers, maxWidth, maxHeight, quality); err != nil {
 			fmt.Printf("处理文件时出错: %v\n", err)
 		}
 	}